@@ -9,12 +9,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
 	"strings"
 
 	"github.com/shykes/gha/internal/dagger"
+
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -124,6 +128,15 @@ func New(
 	// +optional
 	// +default="ubuntu-latest"
 	runner string,
+	// Configure a default self-hosted runner label matrix for all workflows, taking
+	// precedence over 'runner' when set
+	// +optional
+	runnerLabels []string,
+	// Configure a default self-hosted runner group for all workflows, combined with
+	// 'runner'/'runnerLabels' if also set
+	// See https://docs.github.com/en/actions/hosting-your-own-runners/managing-self-hosted-runners/managing-access-to-self-hosted-runners-using-groups
+	// +optional
+	runnerGroup string,
 ) *Gha {
 	return &Gha{Settings: Settings{
 		PublicToken:   publicToken,
@@ -131,10 +144,30 @@ func New(
 		DaggerVersion: daggerVersion,
 		StopEngine:    stopEngine,
 		AsJson:        asJson,
-		Runner:        runner,
+		Runner:        defaultRunner(runner, runnerLabels, runnerGroup),
 	}}
 }
 
+// singleRunner builds a RunsOn value out of a single runner label, as taken from a plain
+// string parameter (e.g. pipeline()'s per-call override).
+func singleRunner(label string) RunsOn {
+	if label == "" {
+		return RunsOn{}
+	}
+	return RunsOn{Labels: []string{label}}
+}
+
+// defaultRunner builds the Gha-level default RunsOn out of New's runner-related parameters:
+// runnerLabels take precedence over the single-label 'runner' default, and runnerGroup can
+// be combined with either.
+func defaultRunner(runner string, runnerLabels []string, runnerGroup string) RunsOn {
+	labels := runnerLabels
+	if len(labels) == 0 && runner != "" {
+		labels = []string{runner}
+	}
+	return RunsOn{Labels: labels, Group: runnerGroup}
+}
+
 type Gha struct {
 	// +private
 	PushTriggers []PushTrigger
@@ -160,27 +193,30 @@ type Settings struct {
 	// +private
 	AsJson bool
 	// +private
-	Runner string
+	Runner RunsOn
 }
 
 func (m *Gha) Check(ctx context.Context, repo *dagger.Directory) (*Gha, error) {
 	for _, t := range m.PushTriggers {
-		if err := t.Pipeline.Check(ctx, repo); err != nil {
+		if err := t.Pipeline.Check(ctx, repo, TriggerPush); err != nil {
 			return m, err
 		}
 	}
 	for _, t := range m.PullRequestTriggers {
-		if err := t.Pipeline.Check(ctx, repo); err != nil {
+		if err := t.Pipeline.Check(ctx, repo, TriggerPullRequest); err != nil {
 			return m, err
 		}
 	}
+	// Note: there is no PullRequestTargetTriggers list yet (no OnPullRequestTarget
+	// constructor exists to populate one). TriggerPullRequestTarget is still a valid
+	// TriggerKind to pass to Pipeline.Check directly once that constructor lands.
 	for _, t := range m.DispatchTriggers {
-		if err := t.Pipeline.Check(ctx, repo); err != nil {
+		if err := t.Pipeline.Check(ctx, repo, TriggerDispatch); err != nil {
 			return m, err
 		}
 	}
 	for _, t := range m.IssueCommentTriggers {
-		if err := t.Pipeline.Check(ctx, repo); err != nil {
+		if err := t.Pipeline.Check(ctx, repo, TriggerIssueComment); err != nil {
 			return m, err
 		}
 	}
@@ -213,6 +249,80 @@ func (m *Gha) Config(
 	return dir
 }
 
+// A Github Actions workflow, ready to be marshalled to YAML.
+type Workflow struct {
+	Name        string            `yaml:"name,omitempty"`
+	On          WorkflowTriggers  `yaml:"on"`
+	Concurrency *Concurrency      `yaml:"concurrency,omitempty"`
+	Permissions map[string]string `yaml:"permissions,omitempty"`
+	Jobs        map[string]Job    `yaml:"jobs,omitempty"`
+}
+
+// The 'on:' block of a Github Actions workflow.
+// Populated by the trigger types (PushTrigger, PullRequestTrigger, etc), except for
+// WorkflowCall, which comes from Pipeline.WithReusableWorkflow.
+type WorkflowTriggers struct {
+	WorkflowCall *WorkflowCallTrigger `yaml:"workflow_call,omitempty"`
+}
+
+// The 'on.workflow_call:' block of a reusable workflow.
+type WorkflowCallTrigger struct {
+	Inputs  map[string]Input  `yaml:"inputs,omitempty"`
+	Secrets []string          `yaml:"secrets,omitempty"`
+	Outputs map[string]string `yaml:"outputs,omitempty"`
+}
+
+// A single job within a Github Actions workflow.
+type Job struct {
+	RunsOn         RunsOn            `yaml:"runs-on,omitempty"`
+	Container      *JobContainer     `yaml:"container,omitempty"`
+	Needs          []string          `yaml:"needs,omitempty"`
+	If             string            `yaml:"if,omitempty"`
+	Steps          []JobStep         `yaml:"steps,omitempty"`
+	Strategy       *Strategy         `yaml:"strategy,omitempty"`
+	TimeoutMinutes int               `yaml:"timeout-minutes,omitempty"`
+	Outputs        map[string]string `yaml:"outputs,omitempty"`
+}
+
+// RunsOn is the 'runs-on:' value of a job: a single runner label, a list of labels for a
+// self-hosted runner matrix, or a self-hosted runner group (with optional extra labels).
+type RunsOn struct {
+	Labels []string
+	Group  string
+}
+
+func (r RunsOn) MarshalYAML() (any, error) {
+	if r.Group != "" {
+		group := map[string]any{"group": r.Group}
+		if len(r.Labels) > 0 {
+			group["labels"] = r.Labels
+		}
+		return group, nil
+	}
+	if len(r.Labels) == 1 {
+		return r.Labels[0], nil
+	}
+	return r.Labels, nil
+}
+
+// The 'strategy:' block of a Github Actions job, for matrix builds.
+type Strategy struct {
+	Matrix      map[string][]string `yaml:"matrix,omitempty"`
+	MaxParallel int                 `yaml:"max-parallel,omitempty"`
+	FailFast    *bool               `yaml:"fail-fast,omitempty"`
+}
+
+// A single step within a Github Actions job.
+type JobStep struct {
+	Name  string            `yaml:"name,omitempty"`
+	ID    string            `yaml:"id,omitempty"`
+	Uses  string            `yaml:"uses,omitempty"`
+	With  map[string]string `yaml:"with,omitempty"`
+	Shell string            `yaml:"shell,omitempty"`
+	Run   string            `yaml:"run,omitempty"`
+	Env   map[string]string `yaml:"env,omitempty"`
+}
+
 func (m *Gha) pipeline(
 	// The Dagger command to execute
 	// Example 'build --source=.'
@@ -230,7 +340,7 @@ func (m *Gha) pipeline(
 		Settings:       m.Settings,
 	}
 	if runner != "" {
-		p.Settings.Runner = runner
+		p.Settings.Runner = singleRunner(runner)
 	}
 	return p
 }
@@ -247,12 +357,399 @@ type Pipeline struct {
 	SparseCheckout []string
 	// +private
 	Settings Settings
+	// +private
+	Matrix []MatrixDimension
+	// +private
+	MaxParallel int
+	// +private
+	FailFast *bool
+	// +private
+	Concurrency *Concurrency
+	// +private
+	TimeoutMinutes int
+	// +private
+	Permissions map[string]string
+	// +private
+	ReusableWorkflow *ReusableWorkflow
+	// +private
+	Container *JobContainer
+	// +private
+	Dependencies []Pipeline
+	// +private
+	IfExpr string
+	// +private
+	Caches []Cache
+	// +private
+	JobID string
+}
+
+// One 'actions/cache@v4' entry to insert into this pipeline's job.
+type Cache struct {
+	Paths       []string
+	Key         string
+	RestoreKeys []string
+}
+
+// Cache one or more paths across runs using actions/cache@v4, keyed by 'key' and falling
+// back to the (optional) 'restoreKeys' prefixes. Call WithCache again to cache more paths.
+func (p Pipeline) WithCache(paths []string, key string, restoreKeys []string) Pipeline {
+	p.Caches = append(p.Caches, Cache{Paths: paths, Key: key, RestoreKeys: restoreKeys})
+	return p
+}
+
+// Cache the Dagger Engine's state directory across runs, keyed by the runner OS and a hash
+// of dagger.json. This is a shortcut for WithCache that materially cuts cold-start time for
+// pipelines that would otherwise reinstall and rewarm the engine on every run.
+func (p Pipeline) WithDaggerEngineCache() Pipeline {
+	return p.WithCache(
+		[]string{"/var/lib/dagger"},
+		"${{ runner.os }}-dagger-${{ hashFiles('dagger.json') }}",
+		nil,
+	)
+}
+
+// Build the 'actions/cache@v4' steps for this pipeline's configured caches.
+func (p *Pipeline) cacheSteps() []JobStep {
+	steps := make([]JobStep, 0, len(p.Caches))
+	for i, c := range p.Caches {
+		with := map[string]string{
+			"path": strings.Join(c.Paths, "\n"),
+			"key":  c.Key,
+		}
+		if len(c.RestoreKeys) > 0 {
+			with["restore-keys"] = strings.Join(c.RestoreKeys, "\n")
+		}
+		steps = append(steps, JobStep{
+			Name: fmt.Sprintf("Cache (%d)", i+1),
+			Uses: "actions/cache@v4",
+			With: with,
+		})
+	}
+	return steps
+}
+
+// Make this pipeline's job depend on one or more upstream pipelines: Github Actions will
+// wait for them to complete, wiring in the corresponding 'needs:' job IDs. Use Needs to
+// reference an upstream job's outputs from this pipeline's Command.
+func (p Pipeline) DependsOn(upstream ...Pipeline) Pipeline {
+	p.Dependencies = append(p.Dependencies, upstream...)
+	return p
+}
+
+// Set a conditional expression (e.g. "${{ success() }}" or "${{ github.event_name == 'push' }}")
+// controlling whether Github Actions runs this pipeline's job.
+func (p Pipeline) If(expr string) Pipeline {
+	p.IfExpr = expr
+	return p
+}
+
+// Reference one of this pipeline's job outputs, for use in a downstream pipeline's Command.
+// The downstream pipeline must also call DependsOn(p) for the reference to resolve.
+func (p Pipeline) Needs(outputName string) string {
+	return fmt.Sprintf("${{ needs.%s.outputs.%s }}", p.jobName(), outputName)
+}
+
+// Set an explicit job ID for this pipeline, overriding the Command-derived default. Required
+// whenever two pipelines in the same dependency graph would otherwise share their first
+// Command token (e.g. "build --target=frontend" and "build --target=backend" both default
+// to job ID "build"); collectJobs panics if it finds two different pipelines with the same
+// job ID.
+func (p Pipeline) WithJobID(id string) Pipeline {
+	p.JobID = id
+	return p
+}
+
+// Set this pipeline's 'runs-on:' labels, replacing Settings.Runner's default entirely
+// (e.g. WithRunnerLabels("self-hosted", "linux", "x64", "gpu") for a self-hosted runner
+// matrix). Combining these with the default "ubuntu-latest" would produce a label set no
+// runner can ever match, so the default is dropped rather than appended to.
+func (p Pipeline) WithRunnerLabels(labels ...string) Pipeline {
+	p.Settings.Runner = RunsOn{Labels: labels, Group: p.Settings.Runner.Group}
+	return p
+}
+
+// Target a self-hosted runner group instead of (or alongside) individual runner labels.
+// See https://docs.github.com/en/actions/hosting-your-own-runners/managing-self-hosted-runners/managing-access-to-self-hosted-runners-using-groups
+func (p Pipeline) WithRunnerGroup(group string) Pipeline {
+	p.Settings.Runner.Group = group
+	return p
+}
+
+// Credentials for pulling a private container image used by WithContainer.
+type ContainerCredentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Options for WithContainer.
+type ContainerOptions struct {
+	// +optional
+	Credentials *ContainerCredentials
+	// +optional
+	Env map[string]string
+	// +optional
+	Ports []string
+	// +optional
+	Volumes []string
+}
+
+// The 'jobs.<job ID>.container:' block of a Github Actions job.
+type JobContainer struct {
+	Image       string                `yaml:"image"`
+	Credentials *ContainerCredentials `yaml:"credentials,omitempty"`
+	Env         map[string]string     `yaml:"env,omitempty"`
+	Ports       []string              `yaml:"ports,omitempty"`
+	Volumes     []string              `yaml:"volumes,omitempty"`
+}
+
+// Run this pipeline's job inside a container, instead of directly on the runner.
+// Borrowed from gale's '--container' option; unblocks self-hosted runners that need
+// a specific toolchain baked into an image rather than installed ad hoc.
+func (p Pipeline) WithContainer(image string, options ContainerOptions) Pipeline {
+	p.Container = &JobContainer{
+		Image:       image,
+		Credentials: options.Credentials,
+		Env:         options.Env,
+		Ports:       options.Ports,
+		Volumes:     options.Volumes,
+	}
+	return p
+}
+
+// Configuration for emitting this pipeline as a reusable workflow (on: workflow_call),
+// so it can be invoked from other workflows via 'uses: ./.github/workflows/<name>.yml'.
+type ReusableWorkflow struct {
+	Name    string
+	Inputs  map[string]Input
+	Secrets []string
+	Outputs map[string]string
+}
+
+// One typed input to a reusable workflow, or one input to a composite action.
+type Input struct {
+	Description string `yaml:"description,omitempty"`
+	Required    bool   `yaml:"required,omitempty"`
+	Default     string `yaml:"default,omitempty"`
+	Type        string `yaml:"type,omitempty"`
+}
+
+// Emit this pipeline as a reusable workflow instead of an event-triggered one.
+// 'inputs' and 'outputs' describe the reusable workflow's 'on.workflow_call' interface;
+// 'outputs' maps an output name to the expression that produces it, typically
+// '${{ jobs.<job ID>.outputs.<name> }}', where the job ID is the one set by WithJobID or,
+// by default, the first word of Command.
+func (p Pipeline) WithReusableWorkflow(name string, inputs map[string]Input, secrets []string, outputs map[string]string) Pipeline {
+	p.ReusableWorkflow = &ReusableWorkflow{
+		Name:    name,
+		Inputs:  inputs,
+		Secrets: secrets,
+		Outputs: outputs,
+	}
+	return p
+}
+
+// Emit this pipeline as a standalone workflow file at '.github/workflows/<filename>'.
+// Used directly for a reusable workflow configured with WithReusableWorkflow; regular,
+// trigger-based workflows go through the owning trigger's own Config method instead.
+func (p Pipeline) Config(filename string) *dagger.Directory {
+	return renderConfig(".github/workflows/"+filename, p.asWorkflow(), p.Settings.AsJson)
+}
+
+// Emit this pipeline as a Github composite action at '.github/actions/<name>/action.yml',
+// wrapping the same checkout, install, and exec steps used in a regular workflow job.
+// This lets other repositories consume the pipeline with 'uses: ./.github/actions/<name>'.
+func (p Pipeline) AsCompositeAction(name string) *dagger.Directory {
+	steps := []JobStep{
+		p.checkoutStep(),
+		p.installDaggerStep(),
+		p.warmEngineStep(),
+	}
+	steps = append(steps, p.cacheSteps()...)
+	steps = append(steps, p.callDaggerStep())
+	if p.Settings.StopEngine {
+		steps = append(steps, p.stopEngineStep())
+	}
+	action := CompositeAction{
+		Name:        name,
+		Description: "Run '" + p.Command + "' with Dagger",
+		Runs: CompositeActionRuns{
+			Using: "composite",
+			Steps: steps,
+		},
+	}
+	return renderConfig(".github/actions/"+name+"/action.yml", action, p.Settings.AsJson)
+}
+
+// A Github composite action, ready to be marshalled to YAML as action.yml.
+type CompositeAction struct {
+	Name        string              `yaml:"name,omitempty"`
+	Description string              `yaml:"description,omitempty"`
+	Inputs      map[string]Input    `yaml:"inputs,omitempty"`
+	Runs        CompositeActionRuns `yaml:"runs"`
+}
+
+// The 'runs:' block of a composite action.
+type CompositeActionRuns struct {
+	Using string    `yaml:"using"`
+	Steps []JobStep `yaml:"steps,omitempty"`
+}
+
+// Render a Github config file (a workflow or a composite action) to a directory at the
+// given path, encoded as YAML, or as JSON if asJson is true (JSON is also valid YAML).
+// These types only carry 'yaml' struct tags (and a custom MarshalYAML on RunsOn), so the
+// JSON path always goes through a YAML round-trip rather than encoding/json directly,
+// which would ignore those tags and emit Go-cased keys.
+func renderConfig(path string, v any, asJson bool) *dagger.Directory {
+	yamlData, err := yaml.Marshal(v)
+	if err != nil {
+		// We skip error checking for simplicity
+		// (don't want to plumb error checking everywhere)
+		panic(err)
+	}
+	data := yamlData
+	if asJson {
+		var generic any
+		if err := yaml.Unmarshal(yamlData, &generic); err != nil {
+			panic(err)
+		}
+		data, err = json.MarshalIndent(generic, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+	}
+	return dag.Directory().WithNewFile(path, string(data))
+}
+
+// A Github Actions concurrency group, used to cancel or queue overlapping workflow runs.
+// See https://docs.github.com/en/actions/writing-workflows/choosing-what-your-workflow-does/control-the-concurrency-of-workflows-and-jobs
+type Concurrency struct {
+	Group            string `yaml:"group"`
+	CancelInProgress bool   `yaml:"cancel-in-progress,omitempty"`
+}
+
+// Set a concurrency group for this pipeline's workflow. Github Actions will cancel
+// (if cancelInProgress is true) or queue any other run already in progress for the same group.
+func (p Pipeline) WithConcurrency(group string, cancelInProgress bool) Pipeline {
+	p.Concurrency = &Concurrency{Group: group, CancelInProgress: cancelInProgress}
+	return p
+}
+
+// Set the number of minutes Github Actions will let this pipeline's job run before cancelling it.
+func (p Pipeline) WithTimeout(minutes int) Pipeline {
+	p.TimeoutMinutes = minutes
+	return p
+}
+
+// Set the GITHUB_TOKEN permissions for this pipeline's workflow (the top-level
+// 'permissions:' key, which applies to every job in it), for example {"contents": "read", "id-token": "write"} for OIDC-based cloud auth.
+func (p Pipeline) WithPermissions(permissions map[string]string) Pipeline {
+	p.Permissions = permissions
+	return p
+}
+
+// One dimension of a Github Actions 'strategy.matrix'.
+// Dimensions are kept in call order here, but strategy() collects them into a map, so the
+// rendered 'matrix:' keys come out sorted by name.
+type MatrixDimension struct {
+	Name   string
+	Values []string
+}
+
+// Expand this pipeline into a Github Actions matrix job, by adding one matrix dimension.
+// Call WithMatrix again to add further dimensions, for a multi-dimensional matrix.
+// Matrix values are available to Command as '${{ matrix.<name> }}', and are also
+// exported to the exec step as 'MATRIX_<NAME>' environment variables.
+// Panics if 'name' was already used by an earlier WithMatrix call, since strategy() would
+// otherwise silently let the later call's values overwrite the earlier one's.
+func (p Pipeline) WithMatrix(name string, values []string) Pipeline {
+	for _, dim := range p.Matrix {
+		if dim.Name == name {
+			panic(fmt.Sprintf("gha: matrix dimension %q already set", name))
+		}
+	}
+	p.Matrix = append(p.Matrix, MatrixDimension{Name: name, Values: values})
+	return p
+}
+
+// Set the maximum number of matrix jobs that can run simultaneously.
+// See https://docs.github.com/en/actions/writing-workflows/choosing-what-your-workflow-does/running-variations-of-jobs-in-a-workflow
+func (p Pipeline) WithMaxParallel(max int) Pipeline {
+	p.MaxParallel = max
+	return p
+}
+
+// Configure whether Github Actions cancels all in-progress matrix jobs when one of them fails.
+// Defaults to true, matching Github's own default.
+func (p Pipeline) WithFailFast(failFast bool) Pipeline {
+	p.FailFast = &failFast
+	return p
 }
 
 func (p *Pipeline) Name() string {
 	return strings.SplitN(p.Command, " ", 2)[0]
 }
 
+// TriggerKind identifies which Github Actions event a pipeline is attached to.
+// Pipeline.Check uses it to tell which Dangerous-Workflow rules apply.
+type TriggerKind string
+
+const (
+	TriggerPush              TriggerKind = "push"
+	TriggerPullRequest       TriggerKind = "pull_request"
+	TriggerPullRequestTarget TriggerKind = "pull_request_target"
+	TriggerDispatch          TriggerKind = "workflow_dispatch"
+	TriggerIssueComment      TriggerKind = "issue_comment"
+)
+
+// DangerousWorkflowError reports one or more violations found by the analysis in
+// checkDangerousWorkflow, in the spirit of the OSSF Scorecard "Dangerous-Workflow" check.
+type DangerousWorkflowError struct {
+	Trigger    TriggerKind
+	Pipeline   string
+	Violations []string
+}
+
+func (e *DangerousWorkflowError) Error() string {
+	return fmt.Sprintf("dangerous workflow in pipeline %q (trigger: %s): %s", e.Pipeline, e.Trigger, strings.Join(e.Violations, "; "))
+}
+
+// untrustedEventInterpolation matches a raw '${{ github.event.* }}' placeholder, which Github
+// shell-expands verbatim inside a 'run:' step and is therefore a script-injection vector when
+// the payload is attacker-controlled (e.g. a pull_request_target from a fork).
+var untrustedEventInterpolation = regexp.MustCompile(`\$\{\{\s*github\.event\.[^}]*\}\}`)
+
+// wellKnownSecretName matches secret names that plausibly hold a live credential, as opposed
+// to an arbitrary user-defined build secret. Anchored on '_'/start/end rather than \b, since
+// secret names are conventionally SCREAMING_SNAKE_CASE and '_' is itself a word character, so
+// \bTOKEN\b would not match GITHUB_TOKEN. The anchors still reject a compound word like
+// KEYCHAIN, where nothing separates KEY from CHAIN.
+var wellKnownSecretName = regexp.MustCompile(`(?i)(^|_)(token|secret|password|passwd|key|credential)(_|$)`)
+
+// checkDangerousWorkflow runs a static safety analysis analogous to the OSSF Scorecard
+// "Dangerous-Workflow" check, and returns a DangerousWorkflowError listing every violation found.
+func (p *Pipeline) checkDangerousWorkflow(trigger TriggerKind) error {
+	var violations []string
+
+	if trigger == TriggerPullRequestTarget {
+		if untrustedEventInterpolation.MatchString(p.Command) {
+			violations = append(violations, "command interpolates '${{ github.event.* }}' directly, which Github shell-expands and can be used for script injection")
+		}
+	}
+
+	if trigger == TriggerPullRequest {
+		for _, secretName := range p.Secrets {
+			if wellKnownSecretName.MatchString(secretName) {
+				violations = append(violations, fmt.Sprintf("secret %q looks like a live credential but is exposed to a fork-triggered pull_request workflow", secretName))
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return &DangerousWorkflowError{Trigger: trigger, Pipeline: p.Name(), Violations: violations}
+}
+
 func (p *Pipeline) checkSecretNames() error {
 	// check if the secret name contains only alphanumeric characters and underscores.
 	validName := regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
@@ -290,10 +787,15 @@ func (p *Pipeline) Check(
 	ctx context.Context,
 	// +defaultPath="/"
 	repo *dagger.Directory,
+	// Which Github Actions event this pipeline is attached to, for the Dangerous-Workflow analysis
+	trigger TriggerKind,
 ) error {
 	if err := p.checkSecretNames(); err != nil {
 		return err
 	}
+	if err := p.checkDangerousWorkflow(trigger); err != nil {
+		return err
+	}
 	if err := p.checkCommandAndModule(ctx, repo); err != nil {
 		return err
 	}
@@ -302,32 +804,111 @@ func (p *Pipeline) Check(
 
 // Generate a GHA workflow from a Dagger pipeline definition.
 // The workflow will have no triggers, they should be filled separately.
+// If the pipeline declares upstream dependencies via DependsOn, the workflow gets one
+// job per pipeline in the dependency graph, wired together with 'needs:'.
 func (p *Pipeline) asWorkflow() Workflow {
+	jobs := map[string]Job{}
+	p.collectJobs(jobs)
+	on := WorkflowTriggers{} // Triggers intentionally left blank, except for WorkflowCall
+	name := p.Command
+	if p.ReusableWorkflow != nil {
+		on.WorkflowCall = &WorkflowCallTrigger{
+			Inputs:  p.ReusableWorkflow.Inputs,
+			Secrets: p.ReusableWorkflow.Secrets,
+			Outputs: p.ReusableWorkflow.Outputs,
+		}
+		if p.ReusableWorkflow.Name != "" {
+			name = p.ReusableWorkflow.Name
+		}
+	}
+	return Workflow{
+		Name:        name,
+		On:          on,
+		Concurrency: p.Concurrency,
+		Permissions: p.Permissions,
+		Jobs:        jobs,
+	}
+}
+
+// jobName identifies this pipeline's job within a workflow's 'jobs:' map, and is what
+// downstream pipelines reference via 'needs:'. It must be unique within a dependency graph;
+// use WithJobID to disambiguate pipelines that would otherwise collide.
+func (p *Pipeline) jobName() string {
+	if p.JobID != "" {
+		return p.JobID
+	}
+	return p.Name()
+}
+
+// collectJobs walks this pipeline's dependency graph (depth-first, deduplicated by job name)
+// and adds one Job per pipeline to jobs. A job name already present in jobs is a no-op only
+// if the rendered Job is identical (the same node revisited in a diamond-shaped graph);
+// comparing rendered Jobs, rather than Command strings, catches pipelines that share a
+// Command but differ via WithMatrix/WithContainer/Secrets/Caches/etc. Any other name clash
+// panics instead of silently dropping one of the pipelines.
+func (p *Pipeline) collectJobs(jobs map[string]Job) {
+	name := p.jobName()
+	job := p.job()
+	if existing, ok := jobs[name]; ok {
+		if reflect.DeepEqual(existing, job) {
+			return
+		}
+		panic(fmt.Sprintf("gha: two different pipelines both resolve to job ID %q; use WithJobID to disambiguate them", name))
+	}
+	jobs[name] = job
+	for _, dep := range p.Dependencies {
+		dep.collectJobs(jobs)
+	}
+}
+
+// job builds this pipeline's own Job entry, independent of the rest of the dependency graph.
+func (p *Pipeline) job() Job {
 	steps := []JobStep{
 		p.checkoutStep(),
 		p.installDaggerStep(),
 		p.warmEngineStep(),
-		p.callDaggerStep(),
 	}
+	steps = append(steps, p.cacheSteps()...)
+	steps = append(steps, p.callDaggerStep())
 	if p.Settings.StopEngine {
 		steps = append(steps, p.stopEngineStep())
 	}
-	return Workflow{
-		Name: p.Command,
-		On:   WorkflowTriggers{}, // Triggers intentionally left blank
-		Jobs: map[string]Job{
-			"dagger": Job{
-				RunsOn: p.Settings.Runner,
-				Steps:  steps,
-				Outputs: map[string]string{
-					"stdout": "${{ steps.exec.outputs.stdout }}",
-					"stderr": "${{ steps.exec.outputs.stderr }}",
-				},
-			},
+	var needs []string
+	for _, dep := range p.Dependencies {
+		needs = append(needs, dep.jobName())
+	}
+	return Job{
+		RunsOn:         p.Settings.Runner,
+		Container:      p.Container,
+		Steps:          steps,
+		Strategy:       p.strategy(),
+		TimeoutMinutes: p.TimeoutMinutes,
+		Needs:          needs,
+		If:             p.IfExpr,
+		Outputs: map[string]string{
+			"stdout": "${{ steps.exec.outputs.stdout }}",
+			"stderr": "${{ steps.exec.outputs.stderr }}",
 		},
 	}
 }
 
+// Build the 'strategy:' block for this pipeline's job, or nil if no matrix, max-parallel
+// or fail-fast setting was configured.
+func (p *Pipeline) strategy() *Strategy {
+	if len(p.Matrix) == 0 && p.MaxParallel == 0 && p.FailFast == nil {
+		return nil
+	}
+	matrix := map[string][]string{}
+	for _, dim := range p.Matrix {
+		matrix[dim.Name] = dim.Values
+	}
+	return &Strategy{
+		Matrix:      matrix,
+		MaxParallel: p.MaxParallel,
+		FailFast:    p.FailFast,
+	}
+}
+
 func (p *Pipeline) checkoutStep() JobStep {
 	step := JobStep{
 		Name: "Checkout",
@@ -368,6 +949,10 @@ func (p *Pipeline) callDaggerStep() JobStep {
 	if p.Module != "" {
 		env["DAGGER_MODULE"] = p.Module
 	}
+	// Inject matrix variables
+	for _, dim := range p.Matrix {
+		env["MATRIX_"+strings.ToUpper(dim.Name)] = fmt.Sprintf("${{ matrix.%s }}", dim.Name)
+	}
 	// Inject Dagger Cloud token
 	if !p.Settings.NoTraces {
 		if p.Settings.PublicToken != "" {
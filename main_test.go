@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Guards against encoding/json silently ignoring the 'yaml' struct tags (and RunsOn's
+// custom MarshalYAML) that renderConfig's JSON path relies on.
+func TestRenderConfigJSONRoundTrip(t *testing.T) {
+	job := Job{
+		RunsOn:         RunsOn{Labels: []string{"ubuntu-latest"}},
+		TimeoutMinutes: 10,
+	}
+
+	yamlData, err := yaml.Marshal(job)
+	if err != nil {
+		t.Fatalf("yaml.Marshal: %v", err)
+	}
+	var generic any
+	if err := yaml.Unmarshal(yamlData, &generic); err != nil {
+		t.Fatalf("yaml.Unmarshal: %v", err)
+	}
+	data, err := json.MarshalIndent(generic, "", "  ")
+	if err != nil {
+		t.Fatalf("json.MarshalIndent: %v", err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+
+	if decoded["runs-on"] != "ubuntu-latest" {
+		t.Errorf("runs-on = %v, want %q", decoded["runs-on"], "ubuntu-latest")
+	}
+	if decoded["timeout-minutes"].(float64) != 10 {
+		t.Errorf("timeout-minutes = %v, want 10", decoded["timeout-minutes"])
+	}
+	if _, ok := decoded["RunsOn"]; ok {
+		t.Errorf("decoded JSON still has Go-cased key %q", "RunsOn")
+	}
+}